@@ -0,0 +1,77 @@
+package zhima_proxy_pool
+
+import (
+	"context"
+	"fmt"
+	"github.com/asmcos/requests"
+)
+
+/*
+Fetcher abstracts fetching a batch of freshly bought proxies from an
+upstream IP vendor, so ZhimaProxyPool is not hard-wired to ZhimaHTTP's API
+and callers can mix vendors or fall back when one API errors out.
+*/
+type Fetcher interface {
+	// Fetch() return a batch of freshly bought proxies from the vendor. n is
+	// how many the pool still wants: StaticFetcher returns at most n, while
+	// the vendor fetchers ignore it and return the whole batch their API
+	// replies with.
+	Fetch(ctx context.Context, n int) ([]*Proxy, error)
+}
+
+// ZhimaAPIError is returned by ZhimaFetcher when the zhima API replies
+// with a non-zero business error code, e.g. 111 for "too many requests".
+type ZhimaAPIError struct {
+	Code int
+	Msg  string
+}
+
+func (e *ZhimaAPIError) Error() string {
+	return fmt.Sprintf("zhima api failed, code=%v msg=%v", e.Code, e.Msg)
+}
+
+// ZhimaFetcher fetches proxies from the ZhimaHTTP API (http://h.zhimaruanjian.com/).
+type ZhimaFetcher struct {
+	ApiAddr string
+}
+
+// NewZhimaFetcher() return a ZhimaFetcher instance
+func NewZhimaFetcher(apiAddr string) *ZhimaFetcher {
+	return &ZhimaFetcher{ApiAddr: apiAddr}
+}
+
+// Fetch() call the zhima api and parse its response.
+func (f *ZhimaFetcher) Fetch(ctx context.Context, n int) ([]*Proxy, error) {
+	resp, err := requests.Get(f.ApiAddr)
+	if err != nil {
+		return nil, err
+	}
+	zhimaResp := new(response)
+	if err := resp.Json(zhimaResp); err != nil {
+		return nil, err
+	}
+	if zhimaResp.Code != 0 {
+		return nil, &ZhimaAPIError{Code: zhimaResp.Code, Msg: zhimaResp.Msg}
+	}
+	return zhimaResp.Data, nil
+}
+
+// StaticFetcher is a Fetcher that always returns a fixed list of proxies.
+// It is meant for tests and local development, where hitting a real paid
+// vendor API is undesirable.
+type StaticFetcher struct {
+	Proxies []*Proxy
+}
+
+// NewStaticFetcher() return a StaticFetcher instance
+func NewStaticFetcher(proxies []*Proxy) *StaticFetcher {
+	return &StaticFetcher{Proxies: proxies}
+}
+
+// Fetch() return up to n proxies from the static list.
+func (f *StaticFetcher) Fetch(ctx context.Context, n int) ([]*Proxy, error) {
+	if n > len(f.Proxies) {
+		n = len(f.Proxies)
+	}
+	return f.Proxies[:n], nil
+}
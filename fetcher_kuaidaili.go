@@ -0,0 +1,54 @@
+package zhima_proxy_pool
+
+import (
+	"context"
+	"fmt"
+	"github.com/asmcos/requests"
+)
+
+// KuaidailiFetcher fetches proxies from Kuaidaili's (https://www.kuaidaili.com/)
+// "dps" secret-key API.
+type KuaidailiFetcher struct {
+	ApiAddr string
+}
+
+// NewKuaidailiFetcher() return a KuaidailiFetcher instance
+func NewKuaidailiFetcher(apiAddr string) *KuaidailiFetcher {
+	return &KuaidailiFetcher{ApiAddr: apiAddr}
+}
+
+type kuaidailiProxy struct {
+	Ip         string `json:"ip"`
+	Port       int    `json:"port"`
+	ExpireTime string `json:"expire_time"`
+}
+
+type kuaidailiResponse struct {
+	Code int               `json:"code"`
+	Msg  string            `json:"msg"`
+	Data []*kuaidailiProxy `json:"data"`
+}
+
+// Fetch() call the kuaidaili api and parse its response.
+func (f *KuaidailiFetcher) Fetch(ctx context.Context, n int) ([]*Proxy, error) {
+	resp, err := requests.Get(f.ApiAddr)
+	if err != nil {
+		return nil, err
+	}
+	kdlResp := new(kuaidailiResponse)
+	if err := resp.Json(kdlResp); err != nil {
+		return nil, err
+	}
+	if kdlResp.Code != 0 {
+		return nil, fmt.Errorf("kuaidaili api failed, code=%v msg=%v", kdlResp.Code, kdlResp.Msg)
+	}
+	proxies := make([]*Proxy, 0, len(kdlResp.Data))
+	for _, p := range kdlResp.Data {
+		proxies = append(proxies, &Proxy{
+			Ip:               p.Ip,
+			Port:             p.Port,
+			ExpireTimeString: p.ExpireTime,
+		})
+	}
+	return proxies, nil
+}
@@ -0,0 +1,54 @@
+package zhima_proxy_pool
+
+import (
+	"context"
+	"fmt"
+	"github.com/asmcos/requests"
+)
+
+// XunDaiLiFetcher fetches proxies from XunDaiLi's (http://www.xdaili.cn/)
+// secret-key API.
+type XunDaiLiFetcher struct {
+	ApiAddr string
+}
+
+// NewXunDaiLiFetcher() return a XunDaiLiFetcher instance
+func NewXunDaiLiFetcher(apiAddr string) *XunDaiLiFetcher {
+	return &XunDaiLiFetcher{ApiAddr: apiAddr}
+}
+
+type xunDaiLiProxy struct {
+	Ip         string `json:"ip"`
+	Port       int    `json:"port"`
+	ExpireTime string `json:"expire_time"`
+}
+
+type xunDaiLiResponse struct {
+	ErrorCode int              `json:"ERRORCODE"`
+	ErrorMsg  string           `json:"ERRORMSG"`
+	Result    []*xunDaiLiProxy `json:"RESULT"`
+}
+
+// Fetch() call the xundaili api and parse its response.
+func (f *XunDaiLiFetcher) Fetch(ctx context.Context, n int) ([]*Proxy, error) {
+	resp, err := requests.Get(f.ApiAddr)
+	if err != nil {
+		return nil, err
+	}
+	xdlResp := new(xunDaiLiResponse)
+	if err := resp.Json(xdlResp); err != nil {
+		return nil, err
+	}
+	if xdlResp.ErrorCode != 0 {
+		return nil, fmt.Errorf("xundaili api failed, code=%v msg=%v", xdlResp.ErrorCode, xdlResp.ErrorMsg)
+	}
+	proxies := make([]*Proxy, 0, len(xdlResp.Result))
+	for _, p := range xdlResp.Result {
+		proxies = append(proxies, &Proxy{
+			Ip:               p.Ip,
+			Port:             p.Port,
+			ExpireTimeString: p.ExpireTime,
+		})
+	}
+	return proxies, nil
+}
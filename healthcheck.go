@@ -0,0 +1,97 @@
+package zhima_proxy_pool
+
+import (
+	"net/http"
+	"time"
+)
+
+/*
+HealthCheckConfig configures ZhimaProxyPool's optional background health
+checker, which periodically probes every active proxy, records its
+latency/success rate on the Proxy itself, and replaces proxies whose
+rolling failure ratio gets too high before they naturally expire.
+*/
+type HealthCheckConfig struct {
+	// Enabled turns the health checker on.
+	Enabled bool
+	// URL is probed with a HEAD request through each active proxy.
+	URL string
+	// Interval is how often every active proxy is probed.
+	Interval time.Duration
+	// Timeout is the per-probe request timeout.
+	Timeout time.Duration
+	// FailureThreshold is the rolling failure ratio (0-1) above which a
+	// proxy is replaced before it naturally expires.
+	FailureThreshold float64
+}
+
+// startHealthCheck() start the background health checker. It is a no-op
+// unless HealthCheck.Enabled is set.
+func (pool *ZhimaProxyPool) startHealthCheck() {
+	if !pool.Config.HealthCheck.Enabled {
+		return
+	}
+	interval := pool.Config.HealthCheck.Interval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	pool.wg.Add(1)
+	go func() {
+		defer pool.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				pool.checkActiveProxies()
+			case <-pool.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// checkActiveProxies() probe every active proxy once.
+func (pool *ZhimaProxyPool) checkActiveProxies() {
+	for _, p := range pool.liveActiveProxies() {
+		pool.checkProxy(p)
+	}
+}
+
+// checkProxy() issue a single HEAD probe through p, record the result on
+// p, and replace p if its rolling failure ratio is now over threshold.
+func (pool *ZhimaProxyPool) checkProxy(p *Proxy) {
+	client := &http.Client{
+		Timeout:   pool.Config.HealthCheck.Timeout,
+		Transport: &http.Transport{Proxy: http.ProxyURL(p.URL())},
+	}
+
+	req, err := http.NewRequest(http.MethodHead, pool.Config.HealthCheck.URL, nil)
+	start := time.Now()
+	ok := false
+	if err == nil {
+		resp, doErr := client.Do(req)
+		if doErr == nil {
+			resp.Body.Close()
+			ok = resp.StatusCode < http.StatusInternalServerError
+		}
+	}
+	latency := time.Since(start)
+
+	pool.activeMutex.Lock()
+	p.Latency = latency
+	p.LastChecked = time.Now()
+	if ok {
+		p.SuccessCount++
+	} else {
+		p.FailCount++
+	}
+	pool.activeMutex.Unlock()
+
+	if !ok && p.FailureRatio() > pool.Config.HealthCheck.FailureThreshold {
+		logger.WithField("proxy", p.ProxyString()).WithField("failure_ratio", p.FailureRatio()).
+			Warn("proxy unhealthy, replacing before expiry")
+		pool.Delete(pool.ctx, p)
+	}
+}
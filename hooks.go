@@ -0,0 +1,21 @@
+package zhima_proxy_pool
+
+/*
+Hooks lets callers observe pool churn events the way they prefer (metrics,
+logging, alerting) instead of digging through logrus debug lines -- this
+matters because paid IPs literally cost money. Every field is optional;
+nil hooks are simply skipped. See the metrics subpackage for a ready-made
+Prometheus-backed implementation.
+*/
+type Hooks struct {
+	// OnFetch is called after every fetch attempt, successful or not, with
+	// the number of proxies fetched (0 on error).
+	OnFetch func(n int, err error)
+	// OnReplace is called whenever an active proxy slot is replaced.
+	OnReplace func(old, new *Proxy)
+	// OnDelete is called whenever an active proxy is removed via Delete(),
+	// including the health checker's removals of unhealthy proxies.
+	OnDelete func(p *Proxy)
+	// OnAPIError is called when a Fetcher reports a ZhimaAPIError.
+	OnAPIError func(code int, msg string)
+}
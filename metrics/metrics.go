@@ -0,0 +1,97 @@
+/*
+Package metrics exposes Prometheus collectors for ZhimaProxyPool churn --
+backup/active pool size, proxies fetched, upstream API errors, replace and
+delete counts, and per-proxy request counts -- plus a Hooks() helper wiring
+those collectors up as a zhima_proxy_pool.Hooks for Config.Hooks.
+*/
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+
+	zhima_proxy_pool "github.com/Sora233/zhima-proxy-pool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	backupSize = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "zhima_proxy_pool",
+		Name:      "backup_size",
+		Help:      "Current number of backup (unpaid) proxies.",
+	})
+	activeSize = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "zhima_proxy_pool",
+		Name:      "active_size",
+		Help:      "Current number of active (paid) proxies.",
+	})
+	fetchedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "zhima_proxy_pool",
+		Name:      "fetched_total",
+		Help:      "Total number of proxies fetched from the upstream vendor.",
+	})
+	apiErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "zhima_proxy_pool",
+		Name:      "api_errors_total",
+		Help:      "Total number of ZhimaHTTP API errors, labelled by zhima error code.",
+	}, []string{"code"})
+	replacedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "zhima_proxy_pool",
+		Name:      "replaced_total",
+		Help:      "Total number of active proxies replaced with a backup, after expiry or Delete().",
+	})
+	deletedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "zhima_proxy_pool",
+		Name:      "deleted_total",
+		Help:      "Total number of active proxies removed via Delete(), including health checker removals.",
+	})
+	proxyRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "zhima_proxy_pool",
+		Name:      "proxy_requests_total",
+		Help:      "Total number of requests made through each active proxy.",
+	}, []string{"proxy"})
+)
+
+// Handler() return an http.Handler serving metrics in the Prometheus
+// exposition format, ready to be mounted at e.g. "/metrics".
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Hooks() return a zhima_proxy_pool.Hooks that updates the collectors
+// above, meant to be assigned directly to Config.Hooks.
+func Hooks() zhima_proxy_pool.Hooks {
+	return zhima_proxy_pool.Hooks{
+		OnFetch: func(n int, err error) {
+			if err == nil {
+				fetchedTotal.Add(float64(n))
+			}
+		},
+		OnReplace: func(old, new *zhima_proxy_pool.Proxy) {
+			replacedTotal.Inc()
+		},
+		OnDelete: func(p *zhima_proxy_pool.Proxy) {
+			deletedTotal.Inc()
+		},
+		OnAPIError: func(code int, msg string) {
+			apiErrorsTotal.WithLabelValues(strconv.Itoa(code)).Inc()
+		},
+	}
+}
+
+// ObserveStats() set the backup/active gauges from a pool snapshot. Pool
+// size isn't event-driven, so call this periodically, e.g. from a ticker
+// alongside pool.Stats().
+func ObserveStats(stats zhima_proxy_pool.Stats) {
+	backupSize.Set(float64(stats.Backup))
+	activeSize.Set(float64(stats.Active))
+}
+
+// ObserveRequest() increment the per-proxy request counter for p. Nothing
+// in this module calls it, the server package included; call it from your
+// own request path each time a request is routed through p.
+func ObserveRequest(p *zhima_proxy_pool.Proxy) {
+	proxyRequestsTotal.WithLabelValues(p.ProxyString()).Inc()
+}
@@ -1,6 +1,7 @@
 package zhima_proxy_pool
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
 )
@@ -14,6 +15,19 @@ type Persister interface {
 	Load() ([]*Proxy, error)
 }
 
+/*
+Locker is optionally implemented by a Persister that backs a pool shared
+across processes (e.g. RedisPersister). When present, ZhimaProxyPool holds
+it around Stop() and replaceActive() so two processes sharing the same
+active proxies don't race replacing the same expired slot and each burn a
+backup IP on it. ctx bounds how long the caller (e.g. Get(ctx)) is willing
+to wait for the lock, so a held lock can't hang an HTTP handler forever.
+*/
+type Locker interface {
+	Lock(ctx context.Context) error
+	Unlock(ctx context.Context) error
+}
+
 // FilePersister is a file based persister
 type FilePersister struct {
 	FilePath string
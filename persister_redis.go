@@ -0,0 +1,175 @@
+package zhima_proxy_pool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+/*
+RedisPersister is a Redis-backed Persister so multiple crawler workers on
+different machines can share the same paid active proxies instead of each
+buying their own. It also implements Locker, taking a SET NX PX lock with
+a background refresh goroutine (similar to the lock-refresh pattern used
+by distributed lockers such as MinIO's) so concurrent Stop()/replaceActive
+calls across processes don't race.
+*/
+type RedisPersister struct {
+	client  *redis.Client
+	key     string
+	lockKey string
+	lockTTL time.Duration
+
+	mu          sync.Mutex
+	lockVal     string
+	refreshDone chan struct{}
+}
+
+// RedisOption configures a RedisPersister.
+type RedisOption func(*RedisPersister)
+
+// WithKeyPrefix sets the redis key prefix used to store the active proxy
+// list and its companion lock. Defaults to "zhima_proxy_pool".
+func WithKeyPrefix(prefix string) RedisOption {
+	return func(p *RedisPersister) {
+		p.key = prefix + ":active"
+		p.lockKey = prefix + ":lock"
+	}
+}
+
+// WithLockTTL sets how long the distributed lock is held before it must be
+// refreshed. Defaults to 10s.
+func WithLockTTL(ttl time.Duration) RedisOption {
+	return func(p *RedisPersister) {
+		p.lockTTL = ttl
+	}
+}
+
+// NewRedisPersister() return a RedisPersister connected to addr.
+func NewRedisPersister(addr string, opts ...RedisOption) *RedisPersister {
+	p := &RedisPersister{
+		client:  redis.NewClient(&redis.Options{Addr: addr}),
+		key:     "zhima_proxy_pool:active",
+		lockKey: "zhima_proxy_pool:lock",
+		lockTTL: 10 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Save the active proxies to redis as a JSON list.
+func (r *RedisPersister) Save(proxies []*Proxy) error {
+	if proxies == nil {
+		return nil
+	}
+	bproxy, err := json.Marshal(proxies)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(context.Background(), r.key, bproxy, 0).Err()
+}
+
+// Load []*Proxy from redis.
+func (r *RedisPersister) Load() ([]*Proxy, error) {
+	bproxy, err := r.client.Get(context.Background(), r.key).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var proxies = make([]*Proxy, 0)
+	if err := json.Unmarshal(bproxy, &proxies); err != nil {
+		return nil, err
+	}
+	return proxies, nil
+}
+
+// Lock() acquire the distributed lock, blocking with a fixed backoff until
+// it is free or ctx is done -- so a caller with a deadline (e.g. Get(ctx))
+// can't hang forever behind a lock some other process is holding -- then
+// starts a goroutine that refreshes its TTL for as long as it is held.
+func (r *RedisPersister) Lock(ctx context.Context) error {
+	val := fmt.Sprintf("%d", rand.Int63())
+
+	for {
+		ok, err := r.client.SetNX(ctx, r.lockKey, val, r.lockTTL).Result()
+		if err != nil {
+			return err
+		}
+		if ok {
+			break
+		}
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	r.mu.Lock()
+	r.lockVal = val
+	done := make(chan struct{})
+	r.refreshDone = done
+	r.mu.Unlock()
+
+	go r.refreshLock(val, done)
+	return nil
+}
+
+// refreshLock() periodically extends the lock's TTL until done is closed.
+func (r *RedisPersister) refreshLock(val string, done chan struct{}) {
+	ticker := time.NewTicker(r.lockTTL / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			r.client.Expire(context.Background(), r.lockKey, r.lockTTL)
+		}
+	}
+}
+
+// Unlock() stop refreshing and release the lock, using a check-and-delete
+// script so we never release a lock that expired and was re-acquired by
+// someone else in the meantime. If ctx is already done, a short detached
+// context is used for the release instead of skipping it, so a caller
+// whose deadline just passed doesn't leave the lock held until lockTTL
+// elapses.
+func (r *RedisPersister) Unlock(ctx context.Context) error {
+	r.mu.Lock()
+	val := r.lockVal
+	done := r.refreshDone
+	r.lockVal = ""
+	r.refreshDone = nil
+	r.mu.Unlock()
+
+	if done != nil {
+		close(done)
+	}
+	if val == "" {
+		return nil
+	}
+
+	if ctx.Err() != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+	}
+
+	script := redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+else
+	return 0
+end`)
+	return script.Run(ctx, r.client, []string{r.lockKey}, val).Err()
+}
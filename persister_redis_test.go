@@ -0,0 +1,80 @@
+//go:build redis
+// +build redis
+
+package zhima_proxy_pool
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestRedisPersisterLockRefreshAndUnlockAfterCancel exercises RedisPersister's
+// distributed lock against a real redis instance: mutual exclusion, the TTL
+// refresh goroutine keeping a long-held lock alive, and Unlock still
+// releasing the lock when called with an already-cancelled ctx.
+//
+// It's gated behind the "redis" build tag and REDIS_ADDR since it needs a
+// live server, e.g.:
+//
+//	docker run --rm -p 6379:6379 redis
+//	REDIS_ADDR=localhost:6379 go test -tags redis -race ./...
+func TestRedisPersisterLockRefreshAndUnlockAfterCancel(t *testing.T) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR not set, skipping redis integration test")
+	}
+
+	ctx := context.Background()
+	newLocker := func() *RedisPersister {
+		return NewRedisPersister(addr, WithKeyPrefix("zhima_proxy_pool_test:"+t.Name()), WithLockTTL(2*time.Second))
+	}
+
+	owner := newLocker()
+	if err := owner.Lock(ctx); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+
+	contender := newLocker()
+	blocked, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	if err := contender.Lock(blocked); err == nil {
+		t.Fatal("expected Lock to block/fail while the owner holds the lock")
+	}
+
+	// Hold past lockTTL to exercise the refresh goroutine -- the lock must
+	// still belong to owner afterwards.
+	time.Sleep(3 * time.Second)
+	stillBlocked, cancel2 := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel2()
+	if err := contender.Lock(stillBlocked); err == nil {
+		t.Fatal("lock refresh did not keep the lock held past its TTL")
+	}
+
+	if err := owner.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+
+	acquired, cancel3 := context.WithTimeout(ctx, time.Second)
+	defer cancel3()
+	if err := contender.Lock(acquired); err != nil {
+		t.Fatalf("expected lock to be acquirable after Unlock: %v", err)
+	}
+
+	// Unlock with an already-cancelled ctx must still release the lock
+	// rather than silently skipping the release.
+	cancelledCtx, cancelNow := context.WithCancel(ctx)
+	cancelNow()
+	if err := contender.Unlock(cancelledCtx); err != nil {
+		t.Fatalf("Unlock with cancelled ctx failed: %v", err)
+	}
+
+	final := newLocker()
+	finalCtx, cancelFinal := context.WithTimeout(ctx, time.Second)
+	defer cancelFinal()
+	if err := final.Lock(finalCtx); err != nil {
+		t.Fatalf("lock should be released after Unlock-after-cancel: %v", err)
+	}
+	_ = final.Unlock(ctx)
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// isAdmin() return whether r targets one of the admin endpoints rather
+// than being a request to be proxied.
+func (s *Server) isAdmin(r *http.Request) bool {
+	// An absolute-form request URL names another host: it is to be proxied.
+	if r.URL.Host != "" {
+		return false
+	}
+	switch r.URL.Path {
+	case "/healthz", "/pool/stats", "/pool/proxies", "/pool/delete":
+		return true
+	default:
+		return false
+	}
+}
+
+// serveAdmin() dispatch /healthz and /pool/* introspection requests.
+func (s *Server) serveAdmin(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/healthz":
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	case "/pool/stats":
+		writeJSON(w, s.config.Pool.Stats())
+	case "/pool/proxies":
+		writeJSON(w, s.config.Pool.ActiveProxies())
+	case "/pool/delete":
+		s.serveDelete(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveDelete() handle /pool/delete?ip=..., removing the matching active
+// proxy (by Ip) from the pool.
+func (s *Server) serveDelete(w http.ResponseWriter, r *http.Request) {
+	ip := r.URL.Query().Get("ip")
+	if ip == "" {
+		http.Error(w, "missing ip query param", http.StatusBadRequest)
+		return
+	}
+
+	for _, p := range s.config.Pool.ActiveProxies() {
+		if p.Ip == ip {
+			deleted := s.config.Pool.Delete(r.Context(), p)
+			writeJSON(w, map[string]bool{"deleted": deleted})
+			return
+		}
+	}
+	http.Error(w, "ip not found in active proxies", http.StatusNotFound)
+}
+
+// writeJSON() write v as a JSON response body.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,156 @@
+/*
+Package server exposes a ZhimaProxyPool as an actual HTTP/HTTPS forward
+proxy, so callers can point any client (including non-Go ones) at e.g.
+http://localhost:8080 instead of calling ZhimaProxyPool.Get() in Go.
+*/
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	zhima_proxy_pool "github.com/Sora233/zhima-proxy-pool"
+	"github.com/sirupsen/logrus"
+)
+
+var logger = logrus.StandardLogger()
+
+// Config is the config for Server
+type Config struct {
+	// Pool is the underlying proxy pool the server rotates through.
+	Pool *zhima_proxy_pool.ZhimaProxyPool
+	// PerHost, if true, sticks to the same upstream proxy for a given
+	// destination host instead of rotating per request.
+	PerHost bool
+	// FailureThreshold is the number of consecutive failures/timeouts
+	// against an upstream proxy before it is deleted from the pool.
+	// Defaults to 3 when left at zero.
+	FailureThreshold int
+	// DialTimeout is the timeout used when dialing the upstream proxy.
+	// Defaults to 10s when left at zero.
+	DialTimeout time.Duration
+}
+
+// Server is an HTTP/HTTPS forward proxy frontend for a ZhimaProxyPool.
+// It implements http.Handler so it can be mounted with http.ListenAndServe
+// directly.
+type Server struct {
+	config *Config
+
+	mu        sync.Mutex
+	failures  map[string]int
+	hostProxy map[string]*zhima_proxy_pool.Proxy
+	transport map[string]*http.Transport
+}
+
+// NewServer() return a Server instance
+func NewServer(config *Config) *Server {
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = 3
+	}
+	if config.DialTimeout <= 0 {
+		config.DialTimeout = 10 * time.Second
+	}
+	return &Server{
+		config:    config,
+		failures:  make(map[string]int),
+		hostProxy: make(map[string]*zhima_proxy_pool.Proxy),
+		transport: make(map[string]*http.Transport),
+	}
+}
+
+// transportFor() return the shared *http.Transport used to reach p,
+// creating and caching one on first use. Reusing one Transport per
+// upstream proxy (instead of building a fresh one per request) lets idle
+// connections actually be pooled and reclaimed via IdleConnTimeout;
+// a fresh zero-value Transport never expires its idle connections.
+func (s *Server) transportFor(p *zhima_proxy_pool.Proxy) *http.Transport {
+	key := p.ProxyString()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.transport[key]; ok {
+		return t
+	}
+	t := &http.Transport{
+		Proxy:           http.ProxyURL(p.URL()),
+		DialContext:     (&net.Dialer{Timeout: s.config.DialTimeout}).DialContext,
+		IdleConnTimeout: 90 * time.Second,
+	}
+	s.transport[key] = t
+	return t
+}
+
+// ServeHTTP implements http.Handler, dispatching admin requests, CONNECT
+// tunnelling for HTTPS and absolute-form requests for plain HTTP.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.isAdmin(r) {
+		s.serveAdmin(w, r)
+		return
+	}
+	if r.Method == http.MethodConnect {
+		s.serveConnect(w, r)
+		return
+	}
+	s.serveHTTP(w, r)
+}
+
+// pickProxy() return the upstream *Proxy to use for host, rotating through
+// pool.Get() unless PerHost is enabled and a proxy is already pinned to it.
+func (s *Server) pickProxy(ctx context.Context, host string) (*zhima_proxy_pool.Proxy, error) {
+	if s.config.PerHost {
+		s.mu.Lock()
+		if p, ok := s.hostProxy[host]; ok {
+			s.mu.Unlock()
+			return p, nil
+		}
+		s.mu.Unlock()
+	}
+
+	p, err := s.config.Pool.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.config.PerHost {
+		s.mu.Lock()
+		s.hostProxy[host] = p
+		s.mu.Unlock()
+	}
+	return p, nil
+}
+
+// onFailure() record a failed/timed out request to p, deleting it from the
+// pool once FailureThreshold consecutive failures have been observed.
+func (s *Server) onFailure(ctx context.Context, host string, p *zhima_proxy_pool.Proxy) {
+	s.mu.Lock()
+	s.failures[p.ProxyString()]++
+	count := s.failures[p.ProxyString()]
+	if s.config.PerHost && s.hostProxy[host] == p {
+		delete(s.hostProxy, host)
+	}
+	s.mu.Unlock()
+
+	if count >= s.config.FailureThreshold {
+		logger.WithField("proxy", p.ProxyString()).WithField("failures", count).
+			Warn("upstream proxy failed too many times, deleting from pool")
+		s.config.Pool.Delete(ctx, p)
+		s.mu.Lock()
+		delete(s.failures, p.ProxyString())
+		if t, ok := s.transport[p.ProxyString()]; ok {
+			t.CloseIdleConnections()
+			delete(s.transport, p.ProxyString())
+		}
+		s.mu.Unlock()
+	}
+}
+
+// onSuccess() reset the failure counter for p.
+func (s *Server) onSuccess(p *zhima_proxy_pool.Proxy) {
+	s.mu.Lock()
+	delete(s.failures, p.ProxyString())
+	s.mu.Unlock()
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+)
+
+// serveConnect() handle an HTTPS CONNECT request by dialing the chosen
+// upstream proxy, asking it to CONNECT to the real target, then splicing
+// the client and upstream connections together.
+func (s *Server) serveConnect(w http.ResponseWriter, r *http.Request) {
+	proxy, err := s.pickProxy(r.Context(), r.Host)
+	if err != nil {
+		logger.Errorf("pick proxy for %v failed %v", r.Host, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	upstream, err := net.DialTimeout("tcp", proxy.ProxyString(), s.config.DialTimeout)
+	if err != nil {
+		s.onFailure(r.Context(), r.Host, proxy)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	_, err = fmt.Fprintf(upstream, "CONNECT %v HTTP/1.1\r\nHost: %v\r\n\r\n", r.Host, r.Host)
+	if err != nil {
+		upstream.Close()
+		s.onFailure(r.Context(), r.Host, proxy)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	upstreamReader := bufio.NewReader(upstream)
+	resp, err := http.ReadResponse(upstreamReader, r)
+	if err != nil {
+		upstream.Close()
+		s.onFailure(r.Context(), r.Host, proxy)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		upstream.Close()
+		s.onFailure(r.Context(), r.Host, proxy)
+		http.Error(w, fmt.Sprintf("upstream proxy refused CONNECT: %v", resp.Status), http.StatusBadGateway)
+		return
+	}
+	s.onSuccess(proxy)
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "hijack not supported", http.StatusInternalServerError)
+		return
+	}
+	client, _, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, _ = client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+
+	go pipe(client, upstream)
+	pipe(upstream, client)
+}
+
+// pipe() copy from src to dst until either side closes.
+func pipe(dst io.WriteCloser, src io.ReadCloser) {
+	defer dst.Close()
+	defer src.Close()
+	_, _ = io.Copy(dst, src)
+}
+
+// serveHTTP() forward a plain absolute-form HTTP request through the chosen
+// upstream proxy and relay the response back to the client.
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	proxy, err := s.pickProxy(r.Context(), r.Host)
+	if err != nil {
+		logger.Errorf("pick proxy for %v failed %v", r.Host, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	transport := s.transportFor(proxy)
+
+	outReq := r.Clone(r.Context())
+	outReq.RequestURI = ""
+
+	resp, err := transport.RoundTrip(outReq)
+	if err != nil {
+		s.onFailure(r.Context(), r.Host, proxy)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	s.onSuccess(proxy)
+
+	for key, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+}
@@ -5,11 +5,13 @@ package zhima_proxy_pool
 
 import (
 	"container/list"
+	"context"
 	"errors"
 	"fmt"
-	"github.com/asmcos/requests"
 	"github.com/sirupsen/logrus"
+	"net/url"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -17,8 +19,12 @@ var logger = logrus.StandardLogger()
 
 // Config is the config for ZhimaProxyPool
 type Config struct {
-	// ApiAddr is the zhima api http address
+	// ApiAddr is the zhima api http address, used to build the default
+	// ZhimaFetcher when Fetcher is left nil.
 	ApiAddr string
+	// Fetcher is the upstream proxy source. If nil, a ZhimaFetcher built
+	// from ApiAddr is used, preserving the original zhima-only behavior.
+	Fetcher Fetcher
 	// BackUpCap is the backup proxy size limit, all backup proxy is costless until they become active one.
 	BackUpCap int
 	// ActiveCap is the active proxy size limit, all active proxy is paid already.
@@ -27,12 +33,35 @@ type Config struct {
 	ClearTime time.Duration
 	// TimLimit is the proxy expire time, depend on your plan.
 	TimeLimit time.Duration
+	// HealthCheck configures the optional background proxy health checker.
+	HealthCheck HealthCheckConfig
+	// Hooks are optional callbacks fired on pool churn events.
+	Hooks Hooks
 }
 
 type Proxy struct {
 	Ip               string `json:"ip"`
 	Port             int    `json:"port"`
 	ExpireTimeString string `json:"expire_time"`
+
+	// Latency is the round-trip time of the last health check probe.
+	Latency time.Duration `json:"latency,omitempty"`
+	// SuccessCount is the number of health check probes that succeeded.
+	SuccessCount int `json:"success_count,omitempty"`
+	// FailCount is the number of health check probes that failed.
+	FailCount int `json:"fail_count,omitempty"`
+	// LastChecked is when the last health check probe completed.
+	LastChecked time.Time `json:"last_checked,omitempty"`
+}
+
+// FailureRatio() return the proxy's rolling health check failure ratio, or
+// 0 if it has never been checked.
+func (p *Proxy) FailureRatio() float64 {
+	total := p.SuccessCount + p.FailCount
+	if total == 0 {
+		return 0
+	}
+	return float64(p.FailCount) / float64(total)
 }
 
 // ExpireTime() return a time.Time parsed from ExpireTimeString
@@ -44,6 +73,15 @@ func (p *Proxy) ProxyString() string {
 	return fmt.Sprintf("%v:%v", p.Ip, p.Port)
 }
 
+// URL() return the proxy address as a "http://ip:port" *url.URL, suitable
+// for http.Transport's Proxy field.
+func (p *Proxy) URL() *url.URL {
+	return &url.URL{
+		Scheme: "http",
+		Host:   p.ProxyString(),
+	}
+}
+
 // Expired() return whether the proxy has expired
 func (p *Proxy) Expired() bool {
 	t, err := p.ExpireTime()
@@ -63,120 +101,178 @@ type response struct {
 // ZhimaProxyPool is the proxy pool implement
 type ZhimaProxyPool struct {
 	Config      *Config
-	api         string
+	fetcher     Fetcher
 	backupProxy *list.List
 	activeProxy []*Proxy
-	*sync.Cond
-	activeMutex *sync.RWMutex
-	persister   Persister
-	index       int
+	// activeMutex guards both activeProxy and backupProxy. backupSignal is
+	// broadcast by closing it and swapping in a fresh channel, replacing
+	// the sync.Cond this pool used to use, so waiters can select on it
+	// alongside a context's Done channel.
+	activeMutex  *sync.RWMutex
+	backupSignal chan struct{}
+	persister    Persister
+	// index is the round-robin cursor used by Get(). It's advanced with
+	// atomic.AddUint64 rather than under activeMutex, since Get() only
+	// takes activeMutex's RLock (many Get() calls run concurrently by
+	// design) and a plain read-modify-write there would race.
+	index uint64
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
 }
 
-// Start() start the background task
+// Start() start the background fill/clear/health-check tasks. It returns
+// once the active proxy list has been filled up to ActiveCap.
 func (pool *ZhimaProxyPool) Start() {
+	pool.wg.Add(2)
 	go pool.fillBackup()
 	go func() {
+		defer pool.wg.Done()
 		ticker := time.NewTicker(pool.Config.ClearTime)
+		defer ticker.Stop()
 		for {
 			select {
 			case <-ticker.C:
 				go pool.Clear()
+			case <-pool.ctx.Done():
+				return
 			}
 		}
 	}()
+	pool.startHealthCheck()
+
 	pool.activeMutex.Lock()
 	defer pool.activeMutex.Unlock()
 	for len(pool.activeProxy) < pool.Config.ActiveCap {
-		backup, err := pool.popBackup()
+		backup, err := pool.popBackup(pool.ctx)
 		if err != nil {
 			logger.Errorf("fill active proxy failed %v", err)
-		} else {
-			pool.activeProxy = append(pool.activeProxy, backup)
+			break
 		}
+		pool.activeProxy = append(pool.activeProxy, backup)
 	}
 }
 
 // Clear() clear the backup proxy list
 func (pool *ZhimaProxyPool) Clear() {
-	pool.L.Lock()
-	defer pool.L.Unlock()
+	pool.activeMutex.Lock()
+	defer pool.activeMutex.Unlock()
 	pool.backupProxy = list.New()
 }
 
+// broadcastBackup() wake every goroutine waiting on backupSignal.
+// caller must hold activeMutex.
+func (pool *ZhimaProxyPool) broadcastBackup() {
+	close(pool.backupSignal)
+	pool.backupSignal = make(chan struct{})
+}
+
+// waitBackupChange() release activeMutex, block until broadcastBackup is
+// called or ctx is done, then re-acquire activeMutex before returning --
+// mirroring how sync.Cond.Wait unlocks/relocks its Locker.
+// caller must hold activeMutex.
+func (pool *ZhimaProxyPool) waitBackupChange(ctx context.Context) error {
+	ch := pool.backupSignal
+	pool.activeMutex.Unlock()
+	defer pool.activeMutex.Lock()
+
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func (pool *ZhimaProxyPool) fillBackup() {
+	defer pool.wg.Done()
+	ctx := pool.ctx
+
 	for {
-		pool.L.Lock()
+		pool.activeMutex.Lock()
 
 		for pool.checkBackup() {
-			pool.Broadcast()
-			pool.Wait()
+			pool.broadcastBackup()
+			if err := pool.waitBackupChange(ctx); err != nil {
+				pool.activeMutex.Unlock()
+				return
+			}
 		}
 		logger.WithField("backup size", pool.backupProxy.Len()).Debug("backup proxy not enough... fresh")
 
 		var loopCount = 0
 
 		for pool.backupProxy.Len() < pool.Config.BackUpCap {
+			if ctx.Err() != nil {
+				pool.activeMutex.Unlock()
+				return
+			}
 			if loopCount >= 5 {
 				logger.WithField("backup size", pool.backupProxy.Len()).
 					Errorf("can not get enough backup proxy after fetch 5 times, check your timeLimit or backupCap")
 				break
 			}
 			loopCount += 1
-			resp, err := requests.Get(pool.api)
-			if err != nil {
-				logger.Errorf("fresh failed %v", err)
-				pool.L.Unlock()
-				break
+			fetched, err := pool.fetcher.Fetch(ctx, pool.Config.BackUpCap-pool.backupProxy.Len())
+			if pool.Config.Hooks.OnFetch != nil {
+				pool.Config.Hooks.OnFetch(len(fetched), err)
 			}
-			zhimaResp := new(response)
-			err = resp.Json(zhimaResp)
 			if err != nil {
-				logger.Errorf("parse zhima response failed %v", err)
-				pool.L.Unlock()
-				break
-			}
-			if zhimaResp.Code != 0 {
-				log := logger.WithField("code", zhimaResp.Code).
-					WithField("msg", zhimaResp.Msg)
-				switch zhimaResp.Code {
-				case 111:
-					time.Sleep(time.Second * 5)
-				default:
-					log.Errorf("fresh failed")
-				}
-			} else {
-				now := time.Now()
-				for _, proxy := range zhimaResp.Data {
-					t, err := proxy.ExpireTime()
-					if err != nil {
-						continue
+				var zhimaErr *ZhimaAPIError
+				if errors.As(err, &zhimaErr) {
+					if pool.Config.Hooks.OnAPIError != nil {
+						pool.Config.Hooks.OnAPIError(zhimaErr.Code, zhimaErr.Msg)
 					}
-					if t.Sub(now) >= pool.Config.TimeLimit {
-						pool.backupProxy.PushBack(proxy)
+					if zhimaErr.Code == 111 {
+						select {
+						case <-time.After(time.Second * 5):
+						case <-ctx.Done():
+							pool.activeMutex.Unlock()
+							return
+						}
+					} else {
+						logger.Errorf("fresh failed %v", err)
 					}
+				} else {
+					logger.Errorf("fresh failed %v", err)
+				}
+				continue
+			}
+			now := time.Now()
+			for _, proxy := range fetched {
+				t, err := proxy.ExpireTime()
+				if err != nil {
+					continue
+				}
+				if t.Sub(now) >= pool.Config.TimeLimit {
+					pool.backupProxy.PushBack(proxy)
 				}
 			}
 		}
 		if pool.checkBackup() {
-			pool.Broadcast()
+			pool.broadcastBackup()
 		}
 		logger.WithField("backup size", pool.backupProxy.Len()).Debug("backup freshed")
-		pool.L.Unlock()
+		pool.activeMutex.Unlock()
 	}
 }
 
 // Get() try to get a usable Proxy.
 // First, get a active proxy, if it has expired, replace it with a backup proxy and return the new proxy.
-func (pool *ZhimaProxyPool) Get() (*Proxy, error) {
+// ctx lets callers (e.g. an HTTP handler) bound how long they're willing
+// to wait for a replacement backup proxy, instead of hanging forever if
+// the fetcher is permanently failing.
+func (pool *ZhimaProxyPool) Get(ctx context.Context) (*Proxy, error) {
 	var result *Proxy
 	pool.activeMutex.RLock()
 
 	if len(pool.activeProxy) == 0 {
+		pool.activeMutex.RUnlock()
 		return nil, errors.New("active proxy empty, please check your config or report bug")
 	}
 
-	pos := pool.index
-	pool.index = (pool.index + 1) % pool.Config.ActiveCap
+	pos := int(atomic.AddUint64(&pool.index, 1)-1) % pool.Config.ActiveCap
 
 	result = pool.activeProxy[pos]
 	if result.Expired() {
@@ -184,7 +280,7 @@ func (pool *ZhimaProxyPool) Get() (*Proxy, error) {
 		pool.activeMutex.Lock()
 		result = pool.activeProxy[pos]
 		if result.Expired() {
-			err := pool.replaceActive(pos)
+			err := pool.replaceActive(ctx, pos)
 			if err != nil {
 				pool.activeMutex.Unlock()
 				return nil, err
@@ -200,50 +296,182 @@ func (pool *ZhimaProxyPool) Get() (*Proxy, error) {
 	return result, nil
 }
 
+// GetBest() try to get the lowest-latency healthy active proxy, based on
+// health check results, instead of rotating round-robin like Get() does.
+// Falls back to Get() when no unexpired active proxy has been checked and
+// is at or under the failure threshold, e.g. before the first health check.
+func (pool *ZhimaProxyPool) GetBest(ctx context.Context) (*Proxy, error) {
+	pool.activeMutex.RLock()
+	var best *Proxy
+	for _, p := range pool.activeProxy {
+		if p.Expired() {
+			continue
+		}
+		if p.SuccessCount+p.FailCount == 0 {
+			continue
+		}
+		if p.FailureRatio() > pool.Config.HealthCheck.FailureThreshold {
+			continue
+		}
+		if best == nil || p.Latency < best.Latency {
+			best = p
+		}
+	}
+	pool.activeMutex.RUnlock()
+
+	if best == nil {
+		return pool.Get(ctx)
+	}
+	return best, nil
+}
+
 // Delete() remove a Proxy from active proxy list.
 // Use it when you make sure the proxy is not usable.
 // Abuse this may cost more.
-func (pool *ZhimaProxyPool) Delete(p *Proxy) bool {
-	pool.L.Lock()
-	defer pool.L.Unlock()
+func (pool *ZhimaProxyPool) Delete(ctx context.Context, p *Proxy) bool {
+	pool.activeMutex.Lock()
+	defer pool.activeMutex.Unlock()
 
 	var result = false
 
 	for index, curProxy := range pool.activeProxy {
 		if curProxy.ProxyString() == p.ProxyString() {
-			err := pool.replaceActive(index)
+			err := pool.replaceActive(ctx, index)
 			if err == nil {
 				result = true
+				if pool.Config.Hooks.OnDelete != nil {
+					pool.Config.Hooks.OnDelete(curProxy)
+				}
 			}
 		}
 	}
 	return result
 }
 
-// Stop() call the persister.Save, this will not stop pool actually.
-func (pool *ZhimaProxyPool) Stop() error {
-	pool.L.Lock()
-	defer pool.L.Unlock()
+// Stop() cancel the background fill/clear/health-check loops, wait for
+// them to exit, then persist the active proxies via the configured
+// Persister. ctx bounds how long to wait for the loops to exit.
+func (pool *ZhimaProxyPool) Stop(ctx context.Context) error {
+	pool.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		pool.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	pool.activeMutex.Lock()
+	defer pool.activeMutex.Unlock()
+	if locker, ok := pool.persister.(Locker); ok {
+		if err := locker.Lock(ctx); err != nil {
+			return err
+		}
+		defer locker.Unlock(ctx)
+	}
 	return pool.persister.Save(pool.activeProxy)
 }
 
-func (pool *ZhimaProxyPool) replaceActive(index int) (err error) {
-	log := logger.WithField("deleted_proxy", pool.activeProxy[index].ProxyString()).WithField("old_expire", pool.activeProxy[index].ExpireTime)
+// Stats is a snapshot of the pool's current backup/active usage.
+type Stats struct {
+	Backup    int `json:"backup"`
+	BackUpCap int `json:"backup_cap"`
+	Active    int `json:"active"`
+	ActiveCap int `json:"active_cap"`
+}
+
+// Stats() return a snapshot of the backup/active pool sizes.
+func (pool *ZhimaProxyPool) Stats() Stats {
+	pool.activeMutex.RLock()
+	defer pool.activeMutex.RUnlock()
+	return Stats{
+		Backup:    pool.backupProxy.Len(),
+		BackUpCap: pool.Config.BackUpCap,
+		Active:    len(pool.activeProxy),
+		ActiveCap: pool.Config.ActiveCap,
+	}
+}
+
+// ActiveProxies() return a snapshot of the current active proxy list. Each
+// Proxy is copied rather than shared, since the health checker mutates
+// Latency/SuccessCount/FailCount/LastChecked on the live *Proxy under
+// activeMutex -- callers reading those fields without the lock (e.g. the
+// admin API) would otherwise race with it.
+func (pool *ZhimaProxyPool) ActiveProxies() []*Proxy {
+	pool.activeMutex.RLock()
+	defer pool.activeMutex.RUnlock()
+	result := make([]*Proxy, len(pool.activeProxy))
+	for i, p := range pool.activeProxy {
+		cp := *p
+		result[i] = &cp
+	}
+	return result
+}
+
+// liveActiveProxies() return the current active proxy list itself, sharing
+// the *Proxy pointers rather than copying them. Unlike ActiveProxies(), it
+// is for internal callers that need to mutate the live Proxy (e.g. the
+// health checker recording Latency/SuccessCount/FailCount) under
+// activeMutex, not for callers reading it unsynchronized.
+func (pool *ZhimaProxyPool) liveActiveProxies() []*Proxy {
+	pool.activeMutex.RLock()
+	defer pool.activeMutex.RUnlock()
+	result := make([]*Proxy, len(pool.activeProxy))
+	copy(result, pool.activeProxy)
+	return result
+}
+
+// replaceActive swaps the expired/deleted proxy at index for a fresh
+// backup. When the persister also implements Locker (e.g. RedisPersister),
+// the swap is done under the distributed lock with a read-modify-write of
+// the shared active list: if another process already replaced this slot
+// since we last saw it, we adopt its result instead of spending one of our
+// own backups on a slot that's no longer stale.
+func (pool *ZhimaProxyPool) replaceActive(ctx context.Context, index int) (err error) {
 	oldProxy := pool.activeProxy[index]
-	newProxy, err := pool.popBackup()
+
+	locker, shared := pool.persister.(Locker)
+	if shared {
+		if err := locker.Lock(ctx); err != nil {
+			return err
+		}
+		defer locker.Unlock(ctx)
+
+		if remote, loadErr := pool.persister.Load(); loadErr == nil &&
+			index < len(remote) && remote[index].ProxyString() != oldProxy.ProxyString() {
+			pool.activeProxy[index] = remote[index]
+			return nil
+		}
+	}
+
+	log := logger.WithField("deleted_proxy", oldProxy.ProxyString()).WithField("old_expire", oldProxy.ExpireTime)
+	newProxy, err := pool.popBackup(ctx)
 	if err != nil {
 		return err
 	}
 	if oldProxy == pool.activeProxy[index] {
 		pool.activeProxy[index] = newProxy
-		log.WithField("new_proxy", pool.activeProxy[index].ProxyString()).WithField("new_expire", pool.activeProxy[index].ExpireTime).Debug("deleted")
+		log.WithField("new_proxy", newProxy.ProxyString()).WithField("new_expire", newProxy.ExpireTime).Debug("deleted")
+		if pool.Config.Hooks.OnReplace != nil {
+			pool.Config.Hooks.OnReplace(oldProxy, newProxy)
+		}
+		if shared {
+			if saveErr := pool.persister.Save(pool.activeProxy); saveErr != nil {
+				logger.Errorf("persist active proxies after replace failed %v", saveErr)
+			}
+		}
 	}
 	return nil
 }
 
 func (pool *ZhimaProxyPool) loadActive(loader func() ([]*Proxy, error)) error {
-	pool.L.Lock()
-	defer pool.L.Unlock()
+	pool.activeMutex.Lock()
+	defer pool.activeMutex.Unlock()
 
 	loaded, err := loader()
 	if err != nil {
@@ -260,11 +488,15 @@ func (pool *ZhimaProxyPool) loadActive(loader func() ([]*Proxy, error)) error {
 	return nil
 }
 
-// caller must hold the lock
-func (pool *ZhimaProxyPool) popBackup() (*Proxy, error) {
+// popBackup() pop a proxy off the backup list, waiting for fillBackup to
+// produce one if it's currently empty, until ctx is done.
+// caller must hold activeMutex.
+func (pool *ZhimaProxyPool) popBackup(ctx context.Context) (*Proxy, error) {
 	for !pool.checkBackup() {
-		pool.Signal()
-		pool.Wait()
+		pool.broadcastBackup()
+		if err := pool.waitBackupChange(ctx); err != nil {
+			return nil, err
+		}
 	}
 	backup := pool.backupProxy.Front()
 	pool.backupProxy.Remove(backup)
@@ -278,13 +510,21 @@ func (pool *ZhimaProxyPool) checkBackup() bool {
 // NewZhimaProxyPool() return a ZhimaProxyPool instance
 func NewZhimaProxyPool(config *Config, persister Persister) *ZhimaProxyPool {
 	activeMutex := new(sync.RWMutex)
+	fetcher := config.Fetcher
+	if fetcher == nil {
+		fetcher = NewZhimaFetcher(config.ApiAddr)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
 	pool := &ZhimaProxyPool{
-		Config:      config,
-		activeProxy: make([]*Proxy, 0),
-		backupProxy: list.New(),
-		Cond:        sync.NewCond(activeMutex),
-		activeMutex: activeMutex,
-		persister:   persister,
+		Config:       config,
+		fetcher:      fetcher,
+		activeProxy:  make([]*Proxy, 0),
+		backupProxy:  list.New(),
+		activeMutex:  activeMutex,
+		backupSignal: make(chan struct{}),
+		persister:    persister,
+		ctx:          ctx,
+		cancel:       cancel,
 	}
 	if err := pool.loadActive(pool.persister.Load); err != nil {
 		logger.WithField("active size", len(pool.activeProxy)).Debug("load err %v", err)
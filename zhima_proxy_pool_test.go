@@ -0,0 +1,59 @@
+package zhima_proxy_pool
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// staticProxies build n Proxy values that all expire an hour from now, far
+// outside TimeLimit, so they stay eligible as backups/actives for the
+// duration of a test.
+func staticProxies(n int) []*Proxy {
+	expire := time.Now().Add(time.Hour).Format("2006-01-02 15:04:05")
+	proxies := make([]*Proxy, 0, n)
+	for i := 0; i < n; i++ {
+		proxies = append(proxies, &Proxy{Ip: "127.0.0.1", Port: 10000 + i, ExpireTimeString: expire})
+	}
+	return proxies
+}
+
+// TestConcurrentGetDeleteStop runs Get/Delete from many goroutines against a
+// StaticFetcher/NilPersister-backed pool under -race, then Stops it, to
+// catch data races in the active-list bookkeeping (e.g. the round-robin
+// index) that a single-goroutine test would never exercise.
+func TestConcurrentGetDeleteStop(t *testing.T) {
+	pool := NewZhimaProxyPool(&Config{
+		Fetcher:   NewStaticFetcher(staticProxies(20)),
+		ActiveCap: 5,
+		BackUpCap: 10,
+		ClearTime: time.Hour,
+		TimeLimit: time.Minute,
+	}, NewNilPersister())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				p, err := pool.Get(ctx)
+				if err != nil {
+					return
+				}
+				if (n+j)%10 == 0 {
+					pool.Delete(ctx, p)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if err := pool.Stop(ctx); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+}